@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podDeleteStatus classifies how a drainHelper intends to handle a pod found
+// on the node being drained.
+type podDeleteStatus int
+
+const (
+	// podDeleteStatusDeletable means the pod can be evicted without any
+	// special handling.
+	podDeleteStatusDeletable podDeleteStatus = iota
+	// podDeleteStatusSkip means the pod is a mirror pod or already
+	// completed, and should be left alone entirely.
+	podDeleteStatusSkip
+	// podDeleteStatusWarn means the pod can be evicted but doing so is
+	// unusual enough to be worth a warning (e.g. it's a bare pod being
+	// force-evicted).
+	podDeleteStatusWarn
+	// podDeleteStatusBlock means the pod must not be evicted: doing so
+	// would either lose its local-only state or delete a pod with no
+	// controller to recreate it.
+	podDeleteStatusBlock
+	// podDeleteStatusProtected means the pod carries a do-not-evict
+	// annotation; whether that blocks the drain is decided by
+	// DrainOptions.BlockingPodPolicy rather than by classifyPod itself.
+	podDeleteStatusProtected
+)
+
+// podSkipKind identifies why classifyPod gave a pod podDeleteStatusSkip, so
+// callers that need to distinguish them (e.g. PlanDrain) don't have to parse
+// podDeleteInfo.reason to tell a mirror pod from a skipped DaemonSet pod.
+type podSkipKind int
+
+const (
+	podSkipKindMirror podSkipKind = iota
+	podSkipKindCompleted
+	podSkipKindDaemonSet
+)
+
+// podBlockKind identifies why classifyPod gave a pod podDeleteStatusBlock.
+type podBlockKind int
+
+const (
+	podBlockKindUnreplicated podBlockKind = iota
+	podBlockKindLocalData
+)
+
+// defaultDoNotEvictAnnotations are the pod annotations that mark a pod as
+// non-evictable out of the box, on top of anything listed in
+// DrainOptions.DoNotEvictAnnotations.
+var defaultDoNotEvictAnnotations = []string{
+	"estafette.io/do-not-evict",
+	"karpenter.sh/do-not-evict",
+}
+
+// podDeleteInfo carries a pod alongside the drainHelper's verdict on it.
+type podDeleteInfo struct {
+	pod    v1.Pod
+	status podDeleteStatus
+	reason string
+
+	// skipKind is set when status is podDeleteStatusSkip, and blockKind when
+	// status is podDeleteStatusBlock, so callers can branch on the actual
+	// reason instead of matching against the free-text reason string.
+	skipKind  podSkipKind
+	blockKind podBlockKind
+
+	// controllerKind is the resolved kind of the controller managing the
+	// pod, e.g. "Deployment" for a pod owned by a ReplicaSet owned in turn
+	// by a Deployment. Empty for bare pods.
+	controllerKind string
+}
+
+// drainHelper decides, for every pod found on a node, whether it can be
+// evicted and how. It is modeled on k8s.io/kubectl/pkg/drain.Helper so that
+// the killer's drain semantics match what operators already expect from
+// `kubectl drain`.
+type drainHelper struct {
+	client    kubernetes.Interface
+	opts      DrainOptions
+	scheduler *EvictionScheduler
+
+	// evictionV1Once/evictionV1Supported cache whether the cluster serves
+	// policy/v1 Evictions, resolved lazily on first use.
+	evictionV1Once      sync.Once
+	evictionV1Supported bool
+
+	// pdbV1Once/pdbV1Supported cache whether the cluster serves policy/v1
+	// PodDisruptionBudgets, resolved lazily on first use.
+	pdbV1Once      sync.Once
+	pdbV1Supported bool
+}
+
+func newDrainHelper(client kubernetes.Interface, opts DrainOptions, scheduler *EvictionScheduler) *drainHelper {
+	return &drainHelper{
+		client:    client,
+		opts:      opts,
+		scheduler: scheduler,
+	}
+}
+
+// getPodsForDeletion lists the pods matching fieldSelector, classifies them,
+// and refuses to proceed if any of them is blocking.
+func (d *drainHelper) getPodsForDeletion(ctx context.Context, fieldSelector string) ([]podDeleteInfo, error) {
+	podList, err := d.client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fieldSelector,
+		LabelSelector: d.opts.PodSelector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d.classifyPods(ctx, podList.Items)
+}
+
+// countPendingPods reports how many non-skipped pods still match
+// fieldSelector, for callers polling a drain to completion.
+func (d *drainHelper) countPendingPods(ctx context.Context, fieldSelector string) (int, error) {
+	podList, err := d.client.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fieldSelector,
+		LabelSelector: d.opts.PodSelector,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, pod := range podList.Items {
+		status := d.classifyPod(ctx, pod).status
+		if status == podDeleteStatusSkip {
+			continue
+		}
+		// Under BlockingPodPolicyIgnore protected pods are never evicted, so
+		// don't make the drain wait on them.
+		if status == podDeleteStatusProtected && d.opts.BlockingPodPolicy == BlockingPodPolicyIgnore {
+			continue
+		}
+		// A pod stuck terminating past SkipWaitForDeleteTimeoutSeconds is
+		// probably never going away cleanly (e.g. a stuck finalizer), so stop
+		// waiting on it rather than blocking the whole drain until DrainTimeout.
+		if d.deletionGracePeriodExceeded(pod) {
+			continue
+		}
+		pending++
+	}
+
+	return pending, nil
+}
+
+// deletionGracePeriodExceeded reports whether pod has been stuck terminating
+// for longer than SkipWaitForDeleteTimeoutSeconds. Zero means never skip.
+func (d *drainHelper) deletionGracePeriodExceeded(pod v1.Pod) bool {
+	if d.opts.SkipWaitForDeleteTimeoutSeconds <= 0 || pod.DeletionTimestamp == nil {
+		return false
+	}
+	return time.Since(pod.DeletionTimestamp.Time) > time.Duration(d.opts.SkipWaitForDeleteTimeoutSeconds)*time.Second
+}
+
+// classifyPods classifies podList and returns an aggregated error listing
+// every blocking pod, if any, instead of silently filtering them out.
+func (d *drainHelper) classifyPods(ctx context.Context, podList []v1.Pod) ([]podDeleteInfo, error) {
+	pods := make([]podDeleteInfo, 0, len(podList))
+	var blocking []error
+
+	for _, pod := range podList {
+		info := d.classifyPod(ctx, pod)
+		if info.status == podDeleteStatusBlock {
+			blocking = append(blocking, fmt.Errorf("%s/%s: %s", pod.Namespace, pod.Name, info.reason))
+		}
+		pods = append(pods, info)
+	}
+
+	if len(blocking) > 0 {
+		return nil, utilerrors.NewAggregate(blocking)
+	}
+
+	return pods, nil
+}
+
+// classifyPod returns the drainHelper's verdict on a single pod.
+func (d *drainHelper) classifyPod(ctx context.Context, pod v1.Pod) podDeleteInfo {
+	if _, ok := pod.ObjectMeta.Annotations[v1.MirrorPodAnnotationKey]; ok {
+		return podDeleteInfo{pod: pod, status: podDeleteStatusSkip, skipKind: podSkipKindMirror, reason: "mirror pod"}
+	}
+
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return podDeleteInfo{pod: pod, status: podDeleteStatusSkip, skipKind: podSkipKindCompleted, reason: "pod already completed"}
+	}
+
+	if reason, protected := d.protectedByAnnotation(pod); protected {
+		return podDeleteInfo{pod: pod, status: podDeleteStatusProtected, reason: reason}
+	}
+
+	controllerRef := metav1.GetControllerOf(&pod)
+
+	if controllerRef != nil && controllerRef.Kind == "DaemonSet" {
+		if d.opts.IgnoreAllDaemonSets {
+			return podDeleteInfo{pod: pod, status: podDeleteStatusSkip, skipKind: podSkipKindDaemonSet, reason: "managed by DaemonSet"}
+		}
+		return podDeleteInfo{pod: pod, status: podDeleteStatusWarn, reason: "managed by DaemonSet"}
+	}
+
+	if controllerRef == nil {
+		if d.opts.Force {
+			return podDeleteInfo{pod: pod, status: podDeleteStatusWarn, reason: "not managed by a controller"}
+		}
+		return podDeleteInfo{pod: pod, status: podDeleteStatusBlock, blockKind: podBlockKindUnreplicated, reason: "not managed by a controller, set Force to evict anyway"}
+	}
+
+	if hasLocalStorage(pod) && !d.opts.DeleteEmptyDirData {
+		return podDeleteInfo{pod: pod, status: podDeleteStatusBlock, blockKind: podBlockKindLocalData, reason: "uses emptyDir local storage, set DeleteEmptyDirData to evict anyway"}
+	}
+
+	return podDeleteInfo{pod: pod, status: podDeleteStatusDeletable, controllerKind: d.controllerKind(ctx, pod, controllerRef)}
+}
+
+// protectedByAnnotation reports whether pod carries a do-not-evict
+// annotation, either one of the built-in defaults or one configured via
+// DrainOptions.DoNotEvictAnnotations.
+func (d *drainHelper) protectedByAnnotation(pod v1.Pod) (reason string, protected bool) {
+	for _, key := range defaultDoNotEvictAnnotations {
+		if value, ok := pod.ObjectMeta.Annotations[key]; ok && value == "true" {
+			return fmt.Sprintf("protected by %s annotation", key), true
+		}
+	}
+
+	for _, key := range d.opts.DoNotEvictAnnotations {
+		if value, ok := pod.ObjectMeta.Annotations[key]; ok && value == "true" {
+			return fmt.Sprintf("protected by %s annotation", key), true
+		}
+	}
+
+	return "", false
+}
+
+// controllerKind resolves controllerRef.Kind to the human-recognisable
+// controller kind managing the pod, following ReplicaSet ownership back to
+// its owning Deployment when there is one.
+func (d *drainHelper) controllerKind(ctx context.Context, pod v1.Pod, controllerRef *metav1.OwnerReference) string {
+	switch controllerRef.Kind {
+	case "ReplicaSet":
+		rs, err := d.client.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, controllerRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return controllerRef.Kind
+		}
+		if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil && rsOwner.Kind == "Deployment" {
+			return "Deployment"
+		}
+		return controllerRef.Kind
+	case "StatefulSet", "Job", "DaemonSet":
+		return controllerRef.Kind
+	default:
+		return controllerRef.Kind
+	}
+}
+
+// hasLocalStorage reports whether pod mounts any emptyDir volume, whose
+// contents are lost once the pod is deleted from the node.
+func hasLocalStorage(pod v1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// pdbInfo is a version-agnostic view of a PodDisruptionBudget: policy/v1 and
+// policy/v1beta1 expose the same Spec.Selector/Status.DisruptionsAllowed
+// fields, so callers that only need those don't have to care which one the
+// cluster actually serves.
+type pdbInfo struct {
+	namespace          string
+	selector           *metav1.LabelSelector
+	disruptionsAllowed int32
+}
+
+// supportsPDBv1 reports whether the cluster serves the policy/v1
+// PodDisruptionBudget resource, caching the discovery result for the
+// lifetime of the drainHelper since it doesn't change mid-drain.
+func (d *drainHelper) supportsPDBv1(ctx context.Context) bool {
+	d.pdbV1Once.Do(func() {
+		resources, err := d.client.Discovery().ServerResourcesForGroupVersion("policy/v1")
+		if err != nil {
+			return
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name == "poddisruptionbudgets" {
+				d.pdbV1Supported = true
+				return
+			}
+		}
+	})
+	return d.pdbV1Supported
+}
+
+// listPDBs lists every PodDisruptionBudget in the cluster, using policy/v1
+// when the cluster serves it and falling back to policy/v1beta1 for clusters
+// older than 1.25, the same fallback eviction already uses.
+func (d *drainHelper) listPDBs(ctx context.Context) ([]pdbInfo, error) {
+	if d.supportsPDBv1(ctx) {
+		list, err := d.client.PolicyV1().PodDisruptionBudgets("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		pdbs := make([]pdbInfo, 0, len(list.Items))
+		for _, pdb := range list.Items {
+			pdbs = append(pdbs, pdbInfo{namespace: pdb.Namespace, selector: pdb.Spec.Selector, disruptionsAllowed: pdb.Status.DisruptionsAllowed})
+		}
+		return pdbs, nil
+	}
+
+	list, err := d.client.PolicyV1beta1().PodDisruptionBudgets("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pdbs := make([]pdbInfo, 0, len(list.Items))
+	for _, pdb := range list.Items {
+		pdbs = append(pdbs, pdbInfo{namespace: pdb.Namespace, selector: pdb.Spec.Selector, disruptionsAllowed: pdb.Status.DisruptionsAllowed})
+	}
+	return pdbs, nil
+}
+
+// podBlockedByPDB reports whether pod is currently covered by a
+// PodDisruptionBudget that has no disruptions left to give, meaning an
+// eviction of pod would be refused with a 429.
+func podBlockedByPDB(pdbs []pdbInfo, pod v1.Pod) bool {
+	for _, pdb := range pdbs {
+		if pdb.namespace != pod.Namespace {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(pdb.selector)
+		if err != nil {
+			continue
+		}
+
+		if selector.Matches(labels.Set(pod.Labels)) && pdb.disruptionsAllowed <= 0 {
+			return true
+		}
+	}
+
+	return false
+}
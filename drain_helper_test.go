@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func podWithOwner(kind string) v1.Pod {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod"},
+	}
+	if kind != "" {
+		pod.OwnerReferences = []metav1.OwnerReference{
+			{Kind: kind, Controller: boolPtr(true)},
+		}
+	}
+	return pod
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestClassifyPod(t *testing.T) {
+	tests := []struct {
+		name       string
+		pod        v1.Pod
+		opts       DrainOptions
+		wantStatus podDeleteStatus
+		wantSkip   podSkipKind
+		wantBlock  podBlockKind
+	}{
+		{
+			name: "mirror pod is skipped",
+			pod: func() v1.Pod {
+				pod := podWithOwner("")
+				pod.Annotations = map[string]string{v1.MirrorPodAnnotationKey: "true"}
+				return pod
+			}(),
+			wantStatus: podDeleteStatusSkip,
+			wantSkip:   podSkipKindMirror,
+		},
+		{
+			name: "completed pod is skipped",
+			pod: func() v1.Pod {
+				pod := podWithOwner("ReplicaSet")
+				pod.Status.Phase = v1.PodSucceeded
+				return pod
+			}(),
+			wantStatus: podDeleteStatusSkip,
+			wantSkip:   podSkipKindCompleted,
+		},
+		{
+			name: "protected pod by annotation",
+			pod: func() v1.Pod {
+				pod := podWithOwner("ReplicaSet")
+				pod.Annotations = map[string]string{"estafette.io/do-not-evict": "true"}
+				return pod
+			}(),
+			wantStatus: podDeleteStatusProtected,
+		},
+		{
+			name:       "daemonset pod is skipped when IgnoreAllDaemonSets is set",
+			pod:        podWithOwner("DaemonSet"),
+			opts:       DrainOptions{IgnoreAllDaemonSets: true},
+			wantStatus: podDeleteStatusSkip,
+			wantSkip:   podSkipKindDaemonSet,
+		},
+		{
+			name:       "daemonset pod warns when IgnoreAllDaemonSets is unset",
+			pod:        podWithOwner("DaemonSet"),
+			wantStatus: podDeleteStatusWarn,
+		},
+		{
+			name:       "bare pod blocks without Force",
+			pod:        podWithOwner(""),
+			wantStatus: podDeleteStatusBlock,
+			wantBlock:  podBlockKindUnreplicated,
+		},
+		{
+			name:       "bare pod warns with Force",
+			pod:        podWithOwner(""),
+			opts:       DrainOptions{Force: true},
+			wantStatus: podDeleteStatusWarn,
+		},
+		{
+			name: "emptyDir pod blocks without DeleteEmptyDirData",
+			pod: func() v1.Pod {
+				pod := podWithOwner("ReplicaSet")
+				pod.Spec.Volumes = []v1.Volume{{VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+				return pod
+			}(),
+			wantStatus: podDeleteStatusBlock,
+			wantBlock:  podBlockKindLocalData,
+		},
+		{
+			name:       "plain replicaset pod is deletable",
+			pod:        podWithOwner("ReplicaSet"),
+			wantStatus: podDeleteStatusDeletable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helper := newDrainHelper(fake.NewSimpleClientset(), tt.opts, nil)
+			info := helper.classifyPod(context.Background(), tt.pod)
+
+			if info.status != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", info.status, tt.wantStatus)
+			}
+			if info.status == podDeleteStatusSkip && info.skipKind != tt.wantSkip {
+				t.Fatalf("skipKind = %v, want %v", info.skipKind, tt.wantSkip)
+			}
+			if info.status == podDeleteStatusBlock && info.blockKind != tt.wantBlock {
+				t.Fatalf("blockKind = %v, want %v", info.blockKind, tt.wantBlock)
+			}
+		})
+	}
+}
+
+func TestPodBlockedByPDB(t *testing.T) {
+	pod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "pod",
+			Labels:    map[string]string{"app": "web"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		pdbs []pdbInfo
+		want bool
+	}{
+		{
+			name: "no PDBs",
+			pdbs: nil,
+			want: false,
+		},
+		{
+			name: "nil selector blocks nothing",
+			pdbs: []pdbInfo{{namespace: "default", selector: nil, disruptionsAllowed: 0}},
+			want: false,
+		},
+		{
+			name: "empty selector matches every pod in namespace",
+			pdbs: []pdbInfo{{namespace: "default", selector: &metav1.LabelSelector{}, disruptionsAllowed: 0}},
+			want: true,
+		},
+		{
+			name: "matching selector with no disruptions left blocks",
+			pdbs: []pdbInfo{{
+				namespace:          "default",
+				selector:           &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				disruptionsAllowed: 0,
+			}},
+			want: true,
+		},
+		{
+			name: "matching selector with disruptions left does not block",
+			pdbs: []pdbInfo{{
+				namespace:          "default",
+				selector:           &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				disruptionsAllowed: 1,
+			}},
+			want: false,
+		},
+		{
+			name: "non-matching selector does not block",
+			pdbs: []pdbInfo{{
+				namespace:          "default",
+				selector:           &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}},
+				disruptionsAllowed: 0,
+			}},
+			want: false,
+		},
+		{
+			name: "PDB in a different namespace is ignored",
+			pdbs: []pdbInfo{{
+				namespace:          "other",
+				selector:           &metav1.LabelSelector{},
+				disruptionsAllowed: 0,
+			}},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podBlockedByPDB(tt.pdbs, pod); got != tt.want {
+				t.Fatalf("podBlockedByPDB() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// disruptionTargetConditionType and disruptionTargetReason mirror the
+// condition the Eviction API itself writes on pods it evicts (reason
+// EvictionByEvictionAPI), so tooling that already watches for
+// DisruptionTarget keeps working for killer-initiated evictions.
+const (
+	disruptionTargetConditionType = "DisruptionTarget"
+	disruptionTargetReason        = "PreemptionByGKEPreemptibleKiller"
+)
+
+// errBlockedByPDB is returned by evictPod when a pod keeps being refused by
+// the Eviction API with a 429 past the helper's MaxEvictionRetries, meaning
+// it's blocked by its PodDisruptionBudget rather than by a transient error.
+type errBlockedByPDB struct {
+	pod string
+}
+
+func (e *errBlockedByPDB) Error() string {
+	return fmt.Sprintf("pod %s is blocked by a pod disruption budget", e.pod)
+}
+
+// supportsEvictionV1 reports whether the cluster serves the policy/v1
+// Eviction subresource, caching the discovery result for the lifetime of the
+// drainHelper since it doesn't change mid-drain.
+func (d *drainHelper) supportsEvictionV1(ctx context.Context) bool {
+	d.evictionV1Once.Do(func() {
+		// The eviction subresource is listed under the core v1 group version,
+		// carrying the policy group and version the server uses for it.
+		resources, err := d.client.Discovery().ServerResourcesForGroupVersion("v1")
+		if err != nil {
+			return
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name == "pods/eviction" && resource.Group == "policy" && resource.Version == "v1" {
+				d.evictionV1Supported = true
+				return
+			}
+		}
+	})
+	return d.evictionV1Supported
+}
+
+// handleProtectedPods applies the helper's BlockingPodPolicy to the set of
+// pods found to carry a do-not-evict annotation. Wait needs no special
+// handling here: protected pods stay in countPendingPods' pending count, so
+// DrainNode's existing polling loop already waits for them up to
+// DrainTimeout.
+func (d *drainHelper) handleProtectedPods(protected []podDeleteInfo) error {
+	names := make([]string, 0, len(protected))
+	for _, p := range protected {
+		names = append(names, fmt.Sprintf("%s/%s", p.pod.Namespace, p.pod.Name))
+	}
+
+	switch d.opts.BlockingPodPolicy {
+	case BlockingPodPolicyIgnore:
+		log.Warn().Msgf("ignoring protected pod(s), they will not be evicted: %s", strings.Join(names, ", "))
+		return nil
+	case BlockingPodPolicyWait:
+		log.Info().Msgf("waiting for protected pod(s) to disappear on their own: %s", strings.Join(names, ", "))
+		return nil
+	default:
+		return fmt.Errorf("aborting drain: protected pod(s) present: %s", strings.Join(names, ", "))
+	}
+}
+
+// evictPods evicts every deletable or warned pod in pods, through the shared
+// EvictionScheduler when one is configured and in local batches otherwise,
+// and stops early if stop is closed.
+func (d *drainHelper) evictPods(ctx context.Context, pods []podDeleteInfo, stop <-chan bool) (lastErr error) {
+	toEvict := make([]v1.Pod, 0, len(pods))
+	var protected []podDeleteInfo
+	for _, p := range pods {
+		switch p.status {
+		case podDeleteStatusSkip:
+			continue
+		case podDeleteStatusProtected:
+			protected = append(protected, p)
+		default:
+			toEvict = append(toEvict, p.pod)
+		}
+	}
+
+	if len(protected) > 0 {
+		if err := d.handleProtectedPods(protected); err != nil {
+			return err
+		}
+	}
+
+	if d.scheduler != nil {
+		return d.scheduler.EvictPods(ctx, d, toEvict, stop)
+	}
+
+	return d.evictPodsLocally(ctx, toEvict, stop)
+}
+
+// evictPodsLocally evicts toEvict in fixed batches of 10, entirely within
+// this node's own drain. It's the fallback used when no cluster-wide
+// EvictionScheduler was configured.
+func (d *drainHelper) evictPodsLocally(ctx context.Context, toEvict []v1.Pod, stop <-chan bool) (lastErr error) {
+	podsPerBatch := 10
+	numPodsLeft := len(toEvict)
+	podsProcessedSoFar := 0
+	errCh := make(chan error)
+	defer func() {
+		if len(errCh) > 0 {
+			thisErr := <-errCh
+			lastErr = fmt.Errorf("error evicting pods, last error was: %s", thisErr.Error())
+		}
+	}()
+
+	for numPodsLeft > 0 {
+		numPodsThisBatch := int(math.Min(float64(numPodsLeft), float64(podsPerBatch)))
+		podsThisBatch := toEvict[podsProcessedSoFar : podsProcessedSoFar+numPodsThisBatch]
+		stopChs := make([]chan bool, numPodsThisBatch)
+		for i := 0; i < len(stopChs); i++ {
+			stopChs[i] = make(chan bool)
+		}
+		wg := &sync.WaitGroup{}
+		for i := 0; i < numPodsThisBatch; i++ {
+			wg.Add(1)
+			go func(i int) {
+				thisPod := podsThisBatch[i]
+				if err := d.evictPod(ctx, thisPod, stopChs[i]); err != nil {
+					log.Error().
+						Err(err).
+						Msgf("failed to evict pod %s", thisPod.Name)
+					errCh <- err
+				}
+				wg.Done()
+			}(i)
+		}
+
+		select {
+		case <-stop:
+			for _, ch := range stopChs {
+				close(ch)
+			}
+			return
+		default:
+			wg.Wait()
+			numPodsLeft -= numPodsThisBatch
+			podsProcessedSoFar += numPodsThisBatch
+		}
+	}
+	return
+}
+
+// markDisruptionTarget patches pod's status with a DisruptionTarget
+// condition before it's evicted, mirroring the condition the Eviction API
+// itself writes, so workload owners can distinguish a planned preemption
+// from an unplanned failure (e.g. to trigger a graceful leader-election
+// handoff).
+func (d *drainHelper) markDisruptionTarget(ctx context.Context, pod v1.Pod) error {
+	message := fmt.Sprintf("Pod evicted due to scheduled preemption of node %s", pod.Spec.NodeName)
+	if !d.opts.ScheduledKillTime.IsZero() {
+		message = fmt.Sprintf("Pod evicted due to scheduled preemption of node %s at %s", pod.Spec.NodeName, d.opts.ScheduledKillTime.Format(time.RFC3339))
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []v1.PodCondition{
+				{
+					Type:               disruptionTargetConditionType,
+					Status:             v1.ConditionTrue,
+					Reason:             disruptionTargetReason,
+					Message:            message,
+					LastTransitionTime: metav1.Now(),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// evictPodOnce attempts exactly one eviction (or plain delete, when
+// DisableEviction is set) of pod and reports whether the Eviction API
+// refused it with a 429, meaning it's currently blocked by its
+// PodDisruptionBudget. It never retries itself, so callers control how (and
+// whether) a blocked pod is retried.
+func (d *drainHelper) evictPodOnce(ctx context.Context, pod v1.Pod) (blocked bool, err error) {
+	if d.opts.DryRun {
+		log.Info().
+			Str("host", pod.Spec.NodeName).
+			Msgf("Dry-run: would evict pod %s", pod.Name)
+		return false, nil
+	}
+
+	var deleteOptions metav1.DeleteOptions
+	if d.opts.GracePeriodSeconds > 0 {
+		gracePeriod := int64(d.opts.GracePeriodSeconds)
+		deleteOptions.GracePeriodSeconds = &gracePeriod
+	}
+
+	if d.opts.DisableEviction {
+		log.Info().
+			Str("host", pod.Spec.NodeName).
+			Msgf("Deleting pod %s (eviction disabled)", pod.Name)
+		err := d.client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, deleteOptions)
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	log.Info().
+		Str("host", pod.Spec.NodeName).
+		Msgf("Evicting pod %s", pod.Name)
+
+	if err := d.markDisruptionTarget(ctx, pod); err != nil {
+		log.Warn().
+			Err(err).
+			Msgf("failed to set DisruptionTarget condition on pod %s", pod.Name)
+	}
+
+	var evictErr error
+	if d.supportsEvictionV1(ctx) {
+		evictErr = d.client.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+			DeleteOptions: &deleteOptions,
+		})
+	} else {
+		evictErr = d.client.PolicyV1beta1().Evictions(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+			DeleteOptions: &deleteOptions,
+		})
+	}
+
+	switch {
+	case evictErr == nil:
+		log.Info().
+			Msgf("pod %s evicted", pod.Name)
+		return false, nil
+	case errors.IsNotFound(evictErr):
+		log.Info().
+			Msgf("pod %s already gone", pod.Name)
+		return false, nil
+	case errors.IsTooManyRequests(evictErr): //We get a 429 in the case of disruption budget related failures
+		return true, nil
+	case errors.IsForbidden(evictErr) && errors.HasStatusCause(evictErr, v1.NamespaceTerminatingCause):
+		log.Warn().
+			Msgf("cannot evict %s, namespace is being deleted", pod.Name)
+		//namespace is being deleted, finalizers should take care of deleting the pod
+		return false, nil
+	default:
+		return false, evictErr
+	}
+}
+
+// evictPod evicts a single pod, retrying on a 429 up to MaxEvictionRetries
+// before giving up with an errBlockedByPDB, rather than retrying forever.
+// It's used by evictPodsLocally, the per-node fallback used when no
+// cluster-wide EvictionScheduler is configured. The EvictionScheduler itself
+// calls evictPodOnce directly and parks blocked pods for a later round
+// instead, so a pod stuck behind an exhausted PodDisruptionBudget doesn't
+// hold one of its limited concurrency slots for the whole retry window.
+func (d *drainHelper) evictPod(ctx context.Context, pod v1.Pod, stop <-chan bool) error {
+	retries := 0
+	for {
+		blocked, err := d.evictPodOnce(ctx, pod)
+		if err != nil {
+			return err
+		}
+		if !blocked {
+			return nil
+		}
+
+		retries++
+		if d.opts.MaxEvictionRetries > 0 && retries > d.opts.MaxEvictionRetries {
+			return &errBlockedByPDB{pod: fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)}
+		}
+		log.Info().
+			Msgf("too many evictions while evicting %s, this may be due to pod disruption budget. trying again soon", pod.Name)
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EvictionSchedulerOptions configures the cluster-wide eviction scheduler
+// shared by every concurrent DrainNode call.
+type EvictionSchedulerOptions struct {
+	// MaxConcurrentEvictions caps how many pods are being evicted at once
+	// across the whole cluster, regardless of how many nodes are draining
+	// simultaneously. Defaults to 20.
+	MaxConcurrentEvictions int
+
+	// EvictionsPerSecond rate-limits eviction calls cluster-wide with a
+	// token-bucket limiter, so many nodes expiring in the same window can't
+	// overwhelm the API server. Zero means unlimited.
+	EvictionsPerSecond float64
+}
+
+// EvictionScheduler is a cluster-wide work queue for pod evictions. A single
+// instance is shared by every drainHelper so that concurrent DrainNode calls
+// on different nodes don't collectively exceed MaxConcurrentEvictions or
+// EvictionsPerSecond, and so pods blocked by an exhausted PodDisruptionBudget
+// are parked and retried with backoff instead of hammering the API server.
+type EvictionScheduler struct {
+	client  kubernetes.Interface
+	limiter *rate.Limiter
+	sem     chan struct{}
+}
+
+// NewEvictionScheduler creates the cluster-wide eviction scheduler. Pass the
+// same instance to every kubernetesClient sharing the cluster.
+func NewEvictionScheduler(client kubernetes.Interface, opts EvictionSchedulerOptions) *EvictionScheduler {
+	concurrency := opts.MaxConcurrentEvictions
+	if concurrency <= 0 {
+		concurrency = 20
+	}
+
+	limit := rate.Limit(opts.EvictionsPerSecond)
+	if opts.EvictionsPerSecond <= 0 {
+		limit = rate.Inf
+	}
+
+	return &EvictionScheduler{
+		client:  client,
+		limiter: rate.NewLimiter(limit, concurrency),
+		sem:     make(chan struct{}, concurrency),
+	}
+}
+
+// EvictPods evicts pods through the shared scheduler: it pre-fetches every
+// PodDisruptionBudget, evicts pods with disruption budget to spare first, and
+// parks pods whose PDB is currently exhausted, retrying them on an
+// exponential backoff rather than repeatedly hitting the Eviction API.
+//
+// Pods are dispatched in waves: every pod in a wave is attempted exactly
+// once, concurrently, and a pod whose attempt comes back blocked by a PDB is
+// parked for the next wave rather than retried in place, so it only ever
+// holds a concurrency slot for the duration of one attempt.
+func (s *EvictionScheduler) EvictPods(ctx context.Context, helper *drainHelper, pods []v1.Pod, stop <-chan bool) error {
+	if len(pods) == 0 {
+		return nil
+	}
+
+	pdbs, err := helper.listPDBs(ctx)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msg("failed to list PodDisruptionBudgets, evicting without PDB-aware ordering")
+	}
+
+	errCh := make(chan error, len(pods))
+	backoff := time.Second
+	attempts := make(map[string]int, len(pods))
+
+	wave, parked := partitionByPDBAvailability(pods, pdbs)
+	parked = s.applyRetryBudget(helper, parked, attempts, errCh)
+
+	for len(wave) > 0 || len(parked) > 0 {
+		if len(wave) == 0 {
+			select {
+			case <-stop:
+				return firstError(errCh)
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+
+			pdbs, err = helper.listPDBs(ctx)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Msg("failed to refresh PodDisruptionBudgets, will retry parked pods again shortly")
+			}
+
+			wave, parked = partitionByPDBAvailability(parked, pdbs)
+			parked = s.applyRetryBudget(helper, parked, attempts, errCh)
+			if len(wave) == 0 {
+				backoff = nextBackoff(backoff)
+				continue
+			}
+			backoff = time.Second
+
+			for _, pod := range wave {
+				log.Info().
+					Msgf("pod %s/%s's PodDisruptionBudget has room again, evicting", pod.Namespace, pod.Name)
+			}
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var stillBlocked []v1.Pod
+
+		for _, pod := range wave {
+			wg.Add(1)
+			go func(pod v1.Pod) {
+				defer wg.Done()
+
+				if err := s.limiter.Wait(ctx); err != nil {
+					errCh <- err
+					return
+				}
+
+				select {
+				case s.sem <- struct{}{}:
+				case <-stop:
+					return
+				}
+				blocked, err := helper.evictPodOnce(ctx, pod)
+				<-s.sem
+
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if blocked {
+					mu.Lock()
+					stillBlocked = append(stillBlocked, pod)
+					mu.Unlock()
+				}
+			}(pod)
+		}
+		wg.Wait()
+
+		select {
+		case <-stop:
+			return firstError(errCh)
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		parked = append(parked, s.applyRetryBudget(helper, stillBlocked, attempts, errCh)...)
+		wave = nil
+	}
+
+	return firstError(errCh)
+}
+
+// applyRetryBudget increments each of blocked's per-pod attempt count and
+// splits off the ones that have now exceeded helper.opts.MaxEvictionRetries,
+// reporting them as errBlockedByPDB on errCh instead of returning them for
+// another park-and-backoff round. Zero means retry forever, the same
+// contract evictPod honors for the evictPodsLocally fallback.
+func (s *EvictionScheduler) applyRetryBudget(helper *drainHelper, blocked []v1.Pod, attempts map[string]int, errCh chan<- error) []v1.Pod {
+	stillParked := make([]v1.Pod, 0, len(blocked))
+	for _, pod := range blocked {
+		key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+		attempts[key]++
+
+		if helper.opts.MaxEvictionRetries > 0 && attempts[key] > helper.opts.MaxEvictionRetries {
+			errCh <- &errBlockedByPDB{pod: key}
+			continue
+		}
+		stillParked = append(stillParked, pod)
+	}
+	return stillParked
+}
+
+// partitionByPDBAvailability splits pods into those currently evictable
+// without violating a PodDisruptionBudget (ready) and those that are
+// (parked).
+func partitionByPDBAvailability(pods []v1.Pod, pdbs []pdbInfo) (ready, parked []v1.Pod) {
+	for _, pod := range pods {
+		if podBlockedByPDB(pdbs, pod) {
+			parked = append(parked, pod)
+		} else {
+			ready = append(ready, pod)
+		}
+	}
+	return
+}
+
+// nextBackoff doubles delay, capping it at one minute so a long-stuck PDB
+// doesn't stretch the retry interval out indefinitely.
+func nextBackoff(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+func firstError(errCh chan error) error {
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			return fmt.Errorf("error evicting pods, first error was: %s", err.Error())
+		}
+	}
+	return nil
+}
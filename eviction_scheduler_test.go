@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func evictableTestPod(name string) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+	}
+}
+
+// alwaysEvictedReactor handles the eviction subresource create directly,
+// since the fake clientset's generic object reactor doesn't know how to
+// store a policy Eviction against a pod.
+func alwaysEvictedReactor(action clienttesting.Action) (bool, runtime.Object, error) {
+	if action.GetSubresource() != "eviction" {
+		return false, nil, nil
+	}
+	return true, nil, nil
+}
+
+func TestEvictionSchedulerEvictPodsSucceeds(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", alwaysEvictedReactor)
+
+	scheduler := NewEvictionScheduler(client, EvictionSchedulerOptions{})
+	helper := newDrainHelper(client, DrainOptions{}, nil)
+
+	stop := make(chan bool)
+	err := scheduler.EvictPods(context.Background(), helper, []v1.Pod{evictableTestPod("pod-a")}, stop)
+	if err != nil {
+		t.Fatalf("EvictPods() = %v, want nil", err)
+	}
+}
+
+// alwaysBlockedByPDBReactor makes every eviction request come back as a 429,
+// as the real Eviction API does when a pod's PodDisruptionBudget has no
+// disruptions left to give.
+func alwaysBlockedByPDBReactor(action clienttesting.Action) (bool, runtime.Object, error) {
+	if action.GetSubresource() != "eviction" {
+		return false, nil, nil
+	}
+	return true, nil, apierrors.NewTooManyRequests("blocked by pod disruption budget", 1)
+}
+
+func TestEvictionSchedulerEvictPodsSurfacesErrBlockedByPDBAfterMaxRetries(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", alwaysBlockedByPDBReactor)
+
+	scheduler := NewEvictionScheduler(client, EvictionSchedulerOptions{})
+	helper := newDrainHelper(client, DrainOptions{MaxEvictionRetries: 1}, nil)
+
+	stop := make(chan bool)
+	err := scheduler.EvictPods(context.Background(), helper, []v1.Pod{evictableTestPod("pod-a")}, stop)
+	if err == nil {
+		t.Fatal("EvictPods() = nil, want an error reporting the pod as blocked by its PodDisruptionBudget")
+	}
+	if !strings.Contains(err.Error(), "blocked by a pod disruption budget") {
+		t.Fatalf("EvictPods() = %v, want it to mention the pod is blocked by a pod disruption budget", err)
+	}
+}
+
+func TestApplyRetryBudget(t *testing.T) {
+	scheduler := NewEvictionScheduler(fake.NewSimpleClientset(), EvictionSchedulerOptions{})
+	helper := newDrainHelper(fake.NewSimpleClientset(), DrainOptions{MaxEvictionRetries: 2}, nil)
+	attempts := make(map[string]int)
+	errCh := make(chan error, 1)
+	pod := evictableTestPod("pod-a")
+
+	for i := 0; i < 2; i++ {
+		stillParked := scheduler.applyRetryBudget(helper, []v1.Pod{pod}, attempts, errCh)
+		if len(stillParked) != 1 {
+			t.Fatalf("attempt %d: stillParked = %d pods, want 1", i+1, len(stillParked))
+		}
+	}
+
+	stillParked := scheduler.applyRetryBudget(helper, []v1.Pod{pod}, attempts, errCh)
+	if len(stillParked) != 0 {
+		t.Fatalf("stillParked = %d pods after exceeding MaxEvictionRetries, want 0", len(stillParked))
+	}
+
+	select {
+	case err := <-errCh:
+		if _, ok := err.(*errBlockedByPDB); !ok {
+			t.Fatalf("errCh received %T, want *errBlockedByPDB", err)
+		}
+	default:
+		t.Fatal("errCh was empty, want an errBlockedByPDB once MaxEvictionRetries is exceeded")
+	}
+}
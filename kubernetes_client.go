@@ -3,41 +3,171 @@ package main
 import (
 	"context"
 	"fmt"
-	"math"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/policy/v1beta1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons recorded on the Node object throughout a preemption cycle, so
+// operators get an audit trail in kubectl/Lens rather than only zerolog
+// output.
+const (
+	EventReasonNodeWillBePreempted = "NodeWillBePreempted"
+	EventReasonDrainStarted        = "DrainStarted"
+	EventReasonDrainCompleted      = "DrainCompleted"
+	EventReasonDrainTimedOut       = "DrainTimedOut"
+	EventReasonDrainAborted        = "DrainAborted"
+	EventReasonNodeDeleted         = "NodeDeleted"
 )
 
 //go:generate mockgen -package=main -destination ./kubernetes_client_mock.go -source=kubernetes_client.go
 type KubernetesClient interface {
-	DrainNode(ctx context.Context, nodeName string, drainTimeout int) (err error)
-	DrainKubeDNSFromNode(ctx context.Context, nodeName string, drainTimeout int) (err error)
+	DrainNode(ctx context.Context, nodeName string, opts DrainOptions) (err error)
+	DrainKubeDNSFromNode(ctx context.Context, nodeName string, opts DrainOptions) (err error)
+	PlanDrain(ctx context.Context, nodeName string) (plan DrainPlan, err error)
 	GetNode(ctx context.Context, nodeName string) (node *v1.Node, err error)
 	DeleteNode(ctx context.Context, nodeName string) (err error)
 	GetPreemptibleNodes(ctx context.Context, filters map[string]string) (nodes *v1.NodeList, err error)
 	GetProjectIdAndZoneFromNode(ctx context.Context, nodeName string) (projectID string, zone string, err error)
 	SetNodeAnnotation(ctx context.Context, nodeName string, key string, value string) (err error)
 	SetUnschedulableState(ctx context.Context, nodeName string, unschedulable bool) (err error)
+	RecordNodeWillBePreempted(ctx context.Context, nodeName string, scheduledKillTime time.Time) (err error)
+}
+
+// DrainOptions configures how a node is drained. It mirrors the knobs exposed
+// by k8s.io/kubectl/pkg/drain.Helper so the killer's eviction behaviour stays
+// familiar to anyone who has used `kubectl drain`.
+type DrainOptions struct {
+	// DrainTimeout is the maximum number of seconds to wait for the node to
+	// finish draining before giving up.
+	DrainTimeout int
+
+	// Force allows eviction of bare pods that aren't managed by any
+	// controller (ReplicaSet, StatefulSet, Job, ...).
+	Force bool
+
+	// IgnoreAllDaemonSets skips pods managed by a DaemonSet instead of
+	// evicting them, since deleting them only has them recreated by the
+	// DaemonSet controller.
+	IgnoreAllDaemonSets bool
+
+	// DeleteEmptyDirData allows eviction of pods using emptyDir volumes,
+	// whose data is lost once the pod is deleted.
+	DeleteEmptyDirData bool
+
+	// GracePeriodSeconds overrides the pod's own termination grace period
+	// when evicting it. Zero means "use the pod's grace period".
+	GracePeriodSeconds int
+
+	// SkipWaitForDeleteTimeoutSeconds skips waiting for a pod's deletion
+	// confirmation when it's already been in a deleting state for at least
+	// this many seconds.
+	SkipWaitForDeleteTimeoutSeconds int
+
+	// DisableEviction forces DrainNode to use plain pod deletion instead of
+	// the Eviction API, for clusters that don't support it.
+	DisableEviction bool
+
+	// MaxEvictionRetries caps how many times a single pod is retried after a
+	// 429 from the Eviction API before it's reported as blocked by its
+	// PodDisruptionBudget. Under the EvictionScheduler, a round in which the
+	// pod is parked because its PodDisruptionBudget has no disruptions left
+	// counts as a retry too, even though no eviction call is made for it.
+	// Zero means retry forever.
+	MaxEvictionRetries int
+
+	// PodSelector restricts the drain to pods matching this label selector.
+	// An empty selector selects every pod on the node.
+	PodSelector string
+
+	// DryRun makes DrainNode and DrainKubeDNSFromNode log the actions they
+	// would take, including cordoning the node, without taking them.
+	DryRun bool
+
+	// DoNotEvictAnnotations lists additional pod annotation keys (beyond the
+	// built-in estafette.io/do-not-evict and karpenter.sh/do-not-evict) that
+	// mark a pod as protected from eviction.
+	DoNotEvictAnnotations []string
+
+	// BlockingPodPolicy decides what happens when protected pods are found
+	// on the node. It is applied before any eviction is dispatched.
+	BlockingPodPolicy BlockingPodPolicy
+
+	// ScheduledKillTime is when the node is expected to be preempted. It is
+	// surfaced in the DisruptionTarget condition set on evicted pods so
+	// workload owners can tell planned disruptions apart from real failures.
+	ScheduledKillTime time.Time
+}
+
+// BlockingPodPolicy controls how DrainNode handles pods protected by a
+// do-not-evict annotation.
+type BlockingPodPolicy string
+
+const (
+	// BlockingPodPolicyAbort fails the drain as soon as a protected pod is
+	// found, leaving the node's pods untouched. This is the default.
+	BlockingPodPolicyAbort BlockingPodPolicy = "abort"
+
+	// BlockingPodPolicyWait lets the drain proceed, waiting for protected
+	// pods to disappear on their own until DrainOptions.DrainTimeout elapses.
+	BlockingPodPolicyWait BlockingPodPolicy = "wait"
+
+	// BlockingPodPolicyIgnore proceeds with the drain and leaves protected
+	// pods running, logging a warning instead of waiting for them.
+	BlockingPodPolicyIgnore BlockingPodPolicy = "ignore"
+)
+
+// DrainPlan is what PlanDrain thinks a real drain of NodeName would do,
+// without ever calling the Eviction API. EvictionOrder lists every pod
+// PlanDrain considers evictable, in the order DrainNode would evict them.
+type DrainPlan struct {
+	NodeName string
+
+	EvictionOrder []string
+
+	SkippedDaemonSet []string
+	BlockedByPDB     []string
+	UnreplicatedBare []string
+	LocalDataOnly    []string
+
+	// Protected lists pods that carry a do-not-evict annotation. Whether a
+	// real drain would stop, wait, or ignore them is decided by
+	// DrainOptions.BlockingPodPolicy at DrainNode time, not by PlanDrain.
+	Protected []string
 }
 
 // NewKubernetesClient return a Kubernetes client
-func NewKubernetesClient(kubeClientset *kubernetes.Clientset) (kubernetes KubernetesClient, err error) {
+func NewKubernetesClient(kubeClientset *kubernetes.Clientset, drainOptions DrainOptions, eventRecorder record.EventRecorder, evictionScheduler *EvictionScheduler) (kubernetes KubernetesClient, err error) {
 	return &kubernetesClient{
-		kubeClientset: kubeClientset,
+		kubeClientset:     kubeClientset,
+		drainOptions:      drainOptions,
+		eventRecorder:     eventRecorder,
+		evictionScheduler: evictionScheduler,
 	}, nil
 }
 
 type kubernetesClient struct {
 	kubeClientset *kubernetes.Clientset
+
+	// drainOptions holds the drain configuration coming from CLI flags, used
+	// by PlanDrain which (unlike DrainNode) takes no per-call options.
+	drainOptions DrainOptions
+
+	// eventRecorder emits Kubernetes Events on the Node object being
+	// preempted, giving operators an audit trail inside kubectl/Lens.
+	eventRecorder record.EventRecorder
+
+	// evictionScheduler, when set, routes every eviction through a single
+	// cluster-wide work queue shared across all concurrent DrainNode calls,
+	// instead of each drain evicting its own pods independently. May be nil,
+	// in which case drainHelper falls back to per-node batching.
+	evictionScheduler *EvictionScheduler
 }
 
 // GetProjectIdAndZoneFromNode returns project id and zone from given node name
@@ -93,9 +223,39 @@ func (c *kubernetesClient) DeleteNode(ctx context.Context, nodeName string) (err
 		return
 	}
 
+	c.recordNodeEvent(ctx, nodeName, v1.EventTypeNormal, EventReasonNodeDeleted, fmt.Sprintf("Node %s deleted by the preemptible killer", nodeName))
+
 	return
 }
 
+// RecordNodeWillBePreempted emits a NodeWillBePreempted event on nodeName, so
+// operators and workload owners see a planned disruption coming before the
+// drain itself starts.
+func (c *kubernetesClient) RecordNodeWillBePreempted(ctx context.Context, nodeName string, scheduledKillTime time.Time) (err error) {
+	c.recordNodeEvent(ctx, nodeName, v1.EventTypeNormal, EventReasonNodeWillBePreempted, fmt.Sprintf("Node %s is scheduled to be preempted at %s", nodeName, scheduledKillTime.Format(time.RFC3339)))
+	return nil
+}
+
+// recordNodeEvent emits a Kubernetes Event on nodeName's Node object. Event
+// emission is best-effort: a missing recorder or a failure to fetch the node
+// is logged but never fails the caller's operation.
+func (c *kubernetesClient) recordNodeEvent(ctx context.Context, nodeName, eventType, reason, message string) {
+	if c.eventRecorder == nil {
+		return
+	}
+
+	node, err := c.GetNode(ctx, nodeName)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("host", nodeName).
+			Msgf("Could not fetch node to record %s event", reason)
+		return
+	}
+
+	c.eventRecorder.Event(node, eventType, reason, message)
+}
+
 // SetNodeAnnotation add an annotation (key/value) to a node from a given node name
 // As the nodes are constantly being updated, the k8s client doesn't support patch feature yet and
 // to reduce the chance to hit a failure 409 we fetch the node before update
@@ -136,19 +296,6 @@ func (c *kubernetesClient) SetUnschedulableState(ctx context.Context, nodeName s
 	return
 }
 
-// filterOutPodByOwnerReferenceKind filter out a list of pods by its owner references kind
-func filterOutPodByOwnerReferenceKind(podList []v1.Pod, kind string) (output []v1.Pod) {
-	for _, pod := range podList {
-		for _, ownerReference := range pod.ObjectMeta.OwnerReferences {
-			if ownerReference.Kind != kind {
-				output = append(output, pod)
-			}
-		}
-	}
-
-	return
-}
-
 // filterOutPodByNode filters out a list of pods by its node
 func filterOutPodByNode(podList []v1.Pod, nodeName string) (output []v1.Pod) {
 	for _, pod := range podList {
@@ -161,38 +308,77 @@ func filterOutPodByNode(podList []v1.Pod, nodeName string) (output []v1.Pod) {
 }
 
 // DrainNode delete every pods from a given node and wait that all pods are removed before it succeed
-// it also make sure we don't select DaemonSet because they are not subject to unschedulable state
-func (c *kubernetesClient) DrainNode(ctx context.Context, nodeName string, drainTimeout int) (err error) {
-	// Select all pods sitting on the node except the one from kube-system
+// Pods are classified through a drainHelper modeled on kubectl's drain logic: DaemonSet pods are
+// skipped when opts.IgnoreAllDaemonSets is set and evicted with a warning otherwise, bare pods and
+// pods using local storage are refused unless explicitly allowed by opts.
+func (c *kubernetesClient) DrainNode(ctx context.Context, nodeName string, opts DrainOptions) (err error) {
+	helper := newDrainHelper(c.kubeClientset, opts, c.evictionScheduler)
+
+	if opts.DryRun {
+		log.Info().
+			Str("host", nodeName).
+			Msg("Dry-run: would cordon node")
+	} else if err = c.SetUnschedulableState(ctx, nodeName, true); err != nil {
+		return err
+	}
 
-	fieldSelector := fmt.Sprintf("spec.nodeName=%v,metadata.namespace!=kube-system", nodeName)
+	c.recordNodeEvent(ctx, nodeName, v1.EventTypeNormal, EventReasonDrainStarted, fmt.Sprintf("Drain of node %s started", nodeName))
 
-	podList, err := c.kubeClientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
-		FieldSelector: fieldSelector,
-	})
+	// Roll the cordon back if the drain fails for any reason: a failed drain
+	// must never leave a node unschedulable forever.
+	defer func() {
+		if err == nil || opts.DryRun {
+			return
+		}
+
+		log.Warn().
+			Err(err).
+			Str("host", nodeName).
+			Msg("Drain failed, uncordoning node")
+
+		if uncordonErr := c.SetUnschedulableState(ctx, nodeName, false); uncordonErr != nil {
+			log.Error().
+				Err(uncordonErr).
+				Str("host", nodeName).
+				Msg("Failed to uncordon node after failed drain")
+		}
+	}()
+
+	// Select all pods sitting on the node except the one from kube-system
+	fieldSelector := fmt.Sprintf("spec.nodeName=%v,metadata.namespace!=kube-system", nodeName)
 
+	pods, err := helper.getPodsForDeletion(ctx, fieldSelector)
 	if err != nil {
-		return
+		return err
 	}
 
-	// Filter out DaemonSet from the list of pods
-	filteredPodList := filterOutPodByOwnerReferenceKind(podList.Items, "DaemonSet")
-
 	log.Info().
 		Str("host", nodeName).
-		Msgf("%d pod(s) found", len(filteredPodList))
+		Msgf("%d pod(s) found", len(pods))
 
 	stopEvicting := make(chan bool)
 	stopPolling := make(chan bool)
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 	defer func() {
 		if len(errCh) > 0 {
 			err = <-errCh
 		}
 	}()
 
+	if opts.DryRun {
+		if err = helper.evictPods(ctx, pods, stopEvicting); err != nil {
+			return err
+		}
+
+		log.Info().
+			Str("host", nodeName).
+			Msg("Dry-run: done draining node")
+
+		return nil
+	}
+
 	go func() {
-		if err := c.evictPods(ctx, filteredPodList, stopEvicting); err != nil {
+		if err := helper.evictPods(ctx, pods, stopEvicting); err != nil {
 			errCh <- err
 		}
 	}()
@@ -203,10 +389,8 @@ func (c *kubernetesClient) DrainNode(ctx context.Context, nodeName string, drain
 		for {
 			sleepTime := ApplyJitter(10)
 			sleepDuration := time.Duration(sleepTime) * time.Second
-			pendingPodList, err := c.kubeClientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
-				FieldSelector: fieldSelector,
-			})
 
+			podsPending, err := helper.countPendingPods(ctx, fieldSelector)
 			if err != nil {
 				log.Error().
 					Err(err).
@@ -217,10 +401,6 @@ func (c *kubernetesClient) DrainNode(ctx context.Context, nodeName string, drain
 				continue
 			}
 
-			// Filter out DaemonSet from the list of pods
-			filteredPendingPodList := filterOutPodByOwnerReferenceKind(pendingPodList.Items, "DaemonSet")
-			podsPending := len(filteredPendingPodList)
-
 			if podsPending == 0 {
 				doneDraining <- true
 				return
@@ -242,19 +422,35 @@ func (c *kubernetesClient) DrainNode(ctx context.Context, nodeName string, drain
 	select {
 	case <-doneDraining:
 		break
-	case <-time.After(time.Duration(drainTimeout) * time.Second):
+	case evictErr := <-errCh:
+		log.Warn().
+			Err(evictErr).
+			Str("host", nodeName).
+			Msg("Draining node aborted")
+		close(stopPolling)
+		close(stopEvicting)
+		c.recordNodeEvent(ctx, nodeName, v1.EventTypeWarning, EventReasonDrainAborted, fmt.Sprintf("Drain of node %s aborted: %v", nodeName, evictErr))
+		err = evictErr
+		return
+	case <-time.After(time.Duration(opts.DrainTimeout) * time.Second):
 		log.Warn().
 			Str("host", nodeName).
 			Msg("Draining node timeout reached")
 		close(stopPolling)
 		close(stopEvicting)
+		c.recordNodeEvent(ctx, nodeName, v1.EventTypeWarning, EventReasonDrainTimedOut, fmt.Sprintf("Drain of node %s timed out after %ds", nodeName, opts.DrainTimeout))
+		err = fmt.Errorf("draining node %s timed out after %ds", nodeName, opts.DrainTimeout)
 		return
 	case <-ctx.Done():
 		close(stopPolling)
 		close(stopEvicting)
+		c.recordNodeEvent(ctx, nodeName, v1.EventTypeWarning, EventReasonDrainTimedOut, fmt.Sprintf("Drain of node %s cancelled: %v", nodeName, ctx.Err()))
+		err = fmt.Errorf("draining node %s cancelled: %w", nodeName, ctx.Err())
 		return
 	}
 
+	c.recordNodeEvent(ctx, nodeName, v1.EventTypeNormal, EventReasonDrainCompleted, fmt.Sprintf("Drain of node %s completed", nodeName))
+
 	log.Info().
 		Str("host", nodeName).
 		Msg("Done draining node")
@@ -263,7 +459,9 @@ func (c *kubernetesClient) DrainNode(ctx context.Context, nodeName string, drain
 }
 
 // DrainKubeDNSFromNode deletes any kube-dns pods running on the node
-func (c *kubernetesClient) DrainKubeDNSFromNode(ctx context.Context, nodeName string, drainTimeout int) (err error) {
+func (c *kubernetesClient) DrainKubeDNSFromNode(ctx context.Context, nodeName string, opts DrainOptions) (err error) {
+	helper := newDrainHelper(c.kubeClientset, opts, c.evictionScheduler)
+
 	// Select all pods sitting on the node except the one from kube-system
 	labelSelector := labels.Set{
 		"k8s-app": "kube-dns",
@@ -279,22 +477,38 @@ func (c *kubernetesClient) DrainKubeDNSFromNode(ctx context.Context, nodeName st
 
 	// Filter out pods running on other nodes
 	filteredPodList := filterOutPodByNode(podList.Items, nodeName)
+	pods, err := helper.classifyPods(ctx, filteredPodList)
+	if err != nil {
+		return err
+	}
 
 	log.Info().
 		Str("host", nodeName).
-		Msgf("%d kube-dns pod(s) found", len(filteredPodList))
+		Msgf("%d kube-dns pod(s) found", len(pods))
 
 	stopEvicting := make(chan bool)
 	stopPolling := make(chan bool)
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 	defer func() {
 		if len(errCh) > 0 {
 			err = <-errCh
 		}
 	}()
 
+	if opts.DryRun {
+		if err = helper.evictPods(ctx, pods, stopEvicting); err != nil {
+			return err
+		}
+
+		log.Info().
+			Str("host", nodeName).
+			Msg("Dry-run: done draining kube-dns from node")
+
+		return nil
+	}
+
 	go func() {
-		if err := c.evictPods(ctx, filteredPodList, stopEvicting); err != nil {
+		if err := helper.evictPods(ctx, pods, stopEvicting); err != nil {
 			errCh <- err
 		}
 	}()
@@ -319,7 +533,7 @@ func (c *kubernetesClient) DrainKubeDNSFromNode(ctx context.Context, nodeName st
 				continue
 			}
 
-			// Filter out DaemonSet from the list of pods
+			// Filter out pods running on other nodes
 			filteredPendingPodList := filterOutPodByNode(podList.Items, nodeName)
 			podsPending := len(filteredPendingPodList)
 
@@ -344,7 +558,7 @@ func (c *kubernetesClient) DrainKubeDNSFromNode(ctx context.Context, nodeName st
 	select {
 	case <-doneDraining:
 		break
-	case <-time.After(time.Duration(drainTimeout) * time.Second):
+	case <-time.After(time.Duration(opts.DrainTimeout) * time.Second):
 		log.Warn().
 			Str("host", nodeName).
 			Msg("Draining kube-dns node timeout reached")
@@ -364,93 +578,58 @@ func (c *kubernetesClient) DrainKubeDNSFromNode(ctx context.Context, nodeName st
 	return
 }
 
-func (c *kubernetesClient) evictPods(ctx context.Context, pods []v1.Pod, stop <-chan bool) (lastErr error) {
-	podsPerBatch := 10
-	numPodsLeft := len(pods)
-	podsProcessedSoFar := 0
-	errCh := make(chan error)
-	defer func() {
-		if len(errCh) > 0 {
-			thisErr := <-errCh
-			lastErr = fmt.Errorf("error evicting pods, last error was: %s", thisErr.Error())
-		}
-	}()
-
-	for numPodsLeft > 0 {
-		numPodsThisBatch := int(math.Min(float64(numPodsLeft), float64(podsPerBatch)))
-		podsThisBatch := pods[podsProcessedSoFar : podsProcessedSoFar+numPodsThisBatch]
-		stopChs := make([]chan bool, numPodsThisBatch)
-		for i := 0; i < len(stopChs); i++ {
-			stopChs[i] = make(chan bool)
-		}
-		wg := &sync.WaitGroup{}
-		for i := 0; i < numPodsThisBatch; i++ {
-			wg.Add(1)
-			go func(i int) {
-				thisPod := podsThisBatch[i]
-				if err := c.evictPod(ctx, thisPod, stopChs[i]); err != nil {
-					log.Error().
-						Err(err).
-						Msgf("failed to evict pod %s", thisPod.Name)
-					errCh <- err
-				}
-				wg.Done()
-			}(i)
-		}
+// PlanDrain classifies every pod on nodeName the way DrainNode would, without
+// calling the Eviction API, so operators can preview a preemption before it
+// happens.
+func (c *kubernetesClient) PlanDrain(ctx context.Context, nodeName string) (plan DrainPlan, err error) {
+	helper := newDrainHelper(c.kubeClientset, c.drainOptions, c.evictionScheduler)
+	plan.NodeName = nodeName
 
-		select {
-		case <-stop:
-			for _, ch := range stopChs {
-				close(ch)
-			}
-			return
-		default:
-			wg.Wait()
-			numPodsLeft -= numPodsThisBatch
-			podsProcessedSoFar += numPodsThisBatch
-		}
+	fieldSelector := fmt.Sprintf("spec.nodeName=%v,metadata.namespace!=kube-system", nodeName)
+	podList, err := c.kubeClientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fieldSelector,
+		LabelSelector: c.drainOptions.PodSelector,
+	})
+	if err != nil {
+		return
 	}
-	return
-}
 
-func (c *kubernetesClient) evictPod(ctx context.Context, pod v1.Pod, stop <-chan bool) error {
-	log.Info().
-		Str("host", pod.Spec.NodeName).
-		Msgf("Evicting pod %s", pod.Name)
-	eviction := &v1beta1.Eviction{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pod.Name,
-			Namespace: pod.Namespace,
-		},
+	pdbs, err := helper.listPDBs(ctx)
+	if err != nil {
+		return
 	}
-	for {
-		err := c.kubeClientset.PolicyV1beta1().Evictions(eviction.Namespace).Evict(ctx, eviction)
-		if err == nil {
-			log.Info().
-				Msgf("pod %s evicted", pod.Name)
-			break
-		} else if errors.IsNotFound(err) {
-			log.Info().
-				Msgf("pod %s already gone", pod.Name)
-			break
-		} else if errors.IsTooManyRequests(err) { //We get a 429 in the case of disruption budget related failures
-			log.Info().
-				Err(err).
-				Msgf("too many evictions while evicting %s, this may be due to pod disruption budget. trying again soon", pod.Name)
-			time.Sleep(5 * time.Second)
-		} else if errors.IsForbidden(err) && errors.HasStatusCause(err, v1.NamespaceTerminatingCause) {
-			log.Warn().
-				Msgf("cannot evict %s, namespace is being deleted", pod.Name)
-			//namespace is being deleted, finalizers should take care of deleting the pod
-			break
-		} else {
-			return err
+
+	for _, pod := range podList.Items {
+		key := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+		info := helper.classifyPod(ctx, pod)
+
+		switch {
+		case info.status == podDeleteStatusSkip && info.skipKind == podSkipKindDaemonSet:
+			plan.SkippedDaemonSet = append(plan.SkippedDaemonSet, key)
+			continue
+		case info.status == podDeleteStatusSkip:
+			// Mirror pods and already-completed pods are skipped regardless
+			// of what's draining the node, so they aren't interesting to a
+			// drain preview.
+			continue
+		case info.status == podDeleteStatusProtected:
+			plan.Protected = append(plan.Protected, key)
+			continue
+		case info.status == podDeleteStatusBlock && info.blockKind == podBlockKindUnreplicated:
+			plan.UnreplicatedBare = append(plan.UnreplicatedBare, key)
+			continue
+		case info.status == podDeleteStatusBlock:
+			plan.LocalDataOnly = append(plan.LocalDataOnly, key)
+			continue
 		}
-		select {
-		case <-stop:
-			return nil
-		default:
+
+		if podBlockedByPDB(pdbs, pod) {
+			plan.BlockedByPDB = append(plan.BlockedByPDB, key)
+			continue
 		}
+
+		plan.EvictionOrder = append(plan.EvictionOrder, key)
 	}
-	return nil
+
+	return
 }